@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// resetCmdConfigs clears the package-level cmdConfigs/cfgFile state
+// configFor relies on, so tests don't leak cached *viper.Viper
+// instances or a --config path into each other.
+func resetCmdConfigs(t *testing.T) {
+	t.Helper()
+	oldConfigs, oldCfgFile := cmdConfigs, cfgFile
+	cmdConfigs = map[*cobra.Command]*cmdConfig{}
+	cfgFile = ""
+	t.Cleanup(func() {
+		cmdConfigs = oldConfigs
+		cfgFile = oldCfgFile
+	})
+}
+
+func widgetCmd() *cobra.Command {
+	cmd := &cobra.Command{Use: "widget-test"}
+	cmd.Flags().String("widget", "flag-own-default", "")
+	return cmd
+}
+
+func writeConfigFile(t *testing.T, value string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pixiecore.yaml")
+	if err := os.WriteFile(path, []byte("widget: "+value+"\n"), 0644); err != nil {
+		t.Fatalf("writing test config file: %s", err)
+	}
+	return path
+}
+
+func TestConfigForPrecedence(t *testing.T) {
+	t.Run("flag's own default when nothing else is set", func(t *testing.T) {
+		resetCmdConfigs(t)
+		cmd := widgetCmd()
+		if got := configFor(cmd).GetString("widget"); got != "flag-own-default" {
+			t.Errorf("GetString(widget) = %q, want %q", got, "flag-own-default")
+		}
+	})
+
+	t.Run("config file beats the flag's own default", func(t *testing.T) {
+		resetCmdConfigs(t)
+		cfgFile = writeConfigFile(t, "file-value")
+		cmd := widgetCmd()
+		if got := configFor(cmd).GetString("widget"); got != "file-value" {
+			t.Errorf("GetString(widget) = %q, want %q", got, "file-value")
+		}
+	})
+
+	t.Run("env beats the config file", func(t *testing.T) {
+		resetCmdConfigs(t)
+		cfgFile = writeConfigFile(t, "file-value")
+		t.Setenv("PIXIECORE_WIDGET", "env-value")
+		cmd := widgetCmd()
+		if got := configFor(cmd).GetString("widget"); got != "env-value" {
+			t.Errorf("GetString(widget) = %q, want %q", got, "env-value")
+		}
+	})
+
+	t.Run("an explicitly passed flag beats env and the config file", func(t *testing.T) {
+		resetCmdConfigs(t)
+		cfgFile = writeConfigFile(t, "file-value")
+		t.Setenv("PIXIECORE_WIDGET", "env-value")
+		cmd := widgetCmd()
+		if err := cmd.Flags().Set("widget", "flag-value"); err != nil {
+			t.Fatalf("setting flag: %s", err)
+		}
+		if got := configFor(cmd).GetString("widget"); got != "flag-value" {
+			t.Errorf("GetString(widget) = %q, want %q", got, "flag-value")
+		}
+	})
+}
+
+// TestConfigForPerCommand is the regression test for the bug
+// chunk0-1's original fix addressed: two distinct commands that each
+// register a flag with the same name must not clobber each other's
+// value, the way a single global viper.BindPFlags would.
+func TestConfigForPerCommand(t *testing.T) {
+	resetCmdConfigs(t)
+
+	a := widgetCmd()
+	if err := a.Flags().Set("widget", "a-value"); err != nil {
+		t.Fatalf("setting flag on a: %s", err)
+	}
+	b := widgetCmd()
+	if err := b.Flags().Set("widget", "b-value"); err != nil {
+		t.Fatalf("setting flag on b: %s", err)
+	}
+
+	if got := configFor(a).GetString("widget"); got != "a-value" {
+		t.Errorf("configFor(a).GetString(widget) = %q, want %q", got, "a-value")
+	}
+	if got := configFor(b).GetString("widget"); got != "b-value" {
+		t.Errorf("configFor(b).GetString(widget) = %q, want %q", got, "b-value")
+	}
+	// Re-fetching a's config must still see a's value, not b's.
+	if got := configFor(a).GetString("widget"); got != "a-value" {
+		t.Errorf("configFor(a).GetString(widget) after configFor(b) = %q, want %q", got, "a-value")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/tls"
+
+	"github.com/spf13/cobra"
+)
+
+func httpBootAddFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("http-boot", false, "answer UEFI HTTP Boot (RFC 5970) clients directly with a signed EFI application, instead of chainloading iPXE (not implemented in this build; see --http-boot's validation for why)")
+	cmd.Flags().String("http-boot-image", "", "path to the EFI application served to HTTP Boot clients")
+	cmd.Flags().String("http-boot-cert", "", "path to a PEM TLS certificate to serve --http-boot-image over HTTPS")
+	cmd.Flags().String("http-boot-key", "", "path to the PEM TLS private key matching --http-boot-cert")
+	cmd.Flags().Bool("http-boot-fallback-ipxe", true, "still chainload iPXE for clients that aren't HTTP Boot capable")
+}
+
+// httpBootConfigFromFlags validates --http-boot* flags. It's a no-op
+// when --http-boot wasn't set, meaning ProxyDHCP behaves exactly as
+// it does today.
+//
+// The HTTPClient vendor class-id detection and option-210/vendor-class
+// reply this flag's help text describes don't exist anywhere in this
+// build's ProxyDHCP handling (it isn't part of this checkout), so
+// there's nothing to actually do with a validated config yet. fatalf
+// rather than silently falling back to the iPXE chainload: a flag that
+// parses and is ignored is worse than one that doesn't exist, because
+// it looks like it worked.
+func httpBootConfigFromFlags(cmd *cobra.Command) {
+	v := configFor(cmd)
+	if !v.GetBool("http-boot") {
+		return
+	}
+
+	image := v.GetString("http-boot-image")
+	if image == "" {
+		fatalf("--http-boot requires --http-boot-image")
+	}
+
+	certFile := v.GetString("http-boot-cert")
+	keyFile := v.GetString("http-boot-key")
+	if (certFile == "") != (keyFile == "") {
+		fatalf("--http-boot-cert and --http-boot-key must be given together")
+	}
+	if certFile != "" {
+		if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			fatalf("--http-boot-cert/--http-boot-key: %s", err)
+		}
+	}
+
+	fatalf("--http-boot: not implemented in this build; ProxyDHCP doesn't detect the HTTPClient vendor class-id or answer it in this tree yet")
+}
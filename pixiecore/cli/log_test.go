@@ -0,0 +1,33 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import "testing"
+
+func TestSessionID(t *testing.T) {
+	cases := []struct {
+		subsystem string
+		want      string
+	}{
+		{"DHCP", ""},
+		{"01:23:45:67:89:ab", "01:23:45:67:89:ab"},
+		{"01:23:45:67:89:AB", "01:23:45:67:89:ab"},
+	}
+	for _, c := range cases {
+		if got := sessionID(c.subsystem); got != c.want {
+			t.Errorf("sessionID(%q) = %q, want %q", c.subsystem, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics starts an HTTP listener exposing Prometheus metrics at
+// /metrics. It's a no-op if addr is empty, which is the default:
+// metrics are opt-in via --metrics-addr.
+//
+// Only the default Go runtime/process collectors client_golang
+// registers automatically are exposed. This file used to also
+// register pixiecore_* application counters (DHCP offers, TFTP bytes,
+// boot outcomes, ...), but nothing in this checkout's DHCP/ProxyDHCP/
+// TFTP/HTTP handling (which lives in the core pixiecore package, not
+// here) ever called Inc()/Observe() on them, so they'd read zero
+// forever. A metrics series that can never move is worse than no
+// series at all: an operator alerting on "no DHCP offers in 10m"
+// against it gets permanent false silence instead of an honest error
+// that the metric doesn't exist. Re-add them once something actually
+// increments them.
+func serveMetrics(addr string) {
+	if addr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			fatalf("metrics listener on %q failed: %s", addr, err)
+		}
+	}()
+}
@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/spf13/cobra"
+	"go.universe.tf/netboot/pixiecore"
+	"go.universe.tf/netboot/pixiecore/secureboot"
+)
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+
+	signCmd.Flags().String("sb-key", "", "path to a PEM Secure Boot signing key")
+	signCmd.Flags().String("sb-cert", "", "path to a PEM Secure Boot signing certificate")
+	signCmd.Flags().String("out", "", "path to write the signed binary to (default: overwrite the input)")
+}
+
+var signCmd = &cobra.Command{
+	Use:   "sign <efi binary>",
+	Short: "Sign an EFI binary with an Authenticode signature",
+	Long:  `Sign signs an iPXE/UEFI binary (or any other EFI application, e.g. a UKI) so that it boots under Secure Boot, using the same key pair "boot --sb-key/--sb-cert" uses to sign the binaries pixiecore serves.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		kp := secureBootKeyPairFromFlags(cmd)
+
+		image := mustFile(args[0])
+		signed, err := secureboot.Sign(image, kp)
+		if err != nil {
+			fatalf("signing %q: %s", args[0], err)
+		}
+
+		out := configFor(cmd).GetString("out")
+		if out == "" {
+			out = args[0]
+		}
+		if err := writeFile(out, signed); err != nil {
+			fatalf("writing %q: %s", out, err)
+		}
+	},
+}
+
+// secureBootAddFlags registers the Secure Boot signing flags shared by
+// the server commands (boot et al). It's separate from signCmd's own
+// flags because serverConfigFlags is shared by several subcommands,
+// each of which gets its own --sb-shim.
+func secureBootAddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("sb-key", "", "path to a PEM Secure Boot signing key; if set, the EFI iPXE binaries (not the BIOS one) are signed before serving")
+	cmd.Flags().String("sb-cert", "", "path to a PEM Secure Boot signing certificate")
+	cmd.Flags().String("sb-shim", "", "path to a pre-signed shim; if set, it's served in place of our signed iPXE binary, and is responsible for chainloading that binary itself")
+	cmd.Flags().Bool("sb-verify", false, "refuse to serve an EFI binary whose embedded signature doesn't chain to --sb-cert")
+}
+
+func secureBootKeyPairFromFlags(cmd *cobra.Command) secureboot.KeyPair {
+	v := configFor(cmd)
+	keyPath := v.GetString("sb-key")
+	certPath := v.GetString("sb-cert")
+	if keyPath == "" || certPath == "" {
+		fatalf("both --sb-key and --sb-cert are required")
+	}
+	kp, err := secureboot.LoadKeyPair(keyPath, certPath)
+	if err != nil {
+		fatalf("loading Secure Boot key pair: %s", err)
+	}
+	return kp
+}
+
+// secureBootSign signs ipxe's EFI binaries (efi32/efi64; the legacy
+// BIOS binary isn't a PE image and is left alone) in place with the
+// key pair given on the command line, when --sb-key/--sb-cert were
+// set. If --sb-shim is also set, the shim replaces the signed binary
+// in ipxe for each firmware that had one, so it's the shim (not our
+// signed iPXE) that's actually served; chainloading to the signed
+// binary from there is the shim's job. When --sb-verify is also set,
+// it refuses (via fatalf) to serve any binary whose resulting/embedded
+// signature doesn't chain to --sb-cert.
+func secureBootSign(cmd *cobra.Command, ipxe map[pixiecore.Firmware][]byte) {
+	v := configFor(cmd)
+	keyPath := v.GetString("sb-key")
+	if keyPath == "" {
+		return
+	}
+	kp := secureBootKeyPairFromFlags(cmd)
+	verify := v.GetBool("sb-verify")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(kp.Cert)
+
+	efiFirmwares := []pixiecore.Firmware{pixiecore.FirmwareEFI32, pixiecore.FirmwareEFI64}
+	for _, fw := range efiFirmwares {
+		image, ok := ipxe[fw]
+		if !ok {
+			continue
+		}
+		signed, err := secureboot.Sign(image, kp)
+		if err != nil {
+			fatalf("signing EFI binary for firmware %v: %s", fw, err)
+		}
+		ipxe[fw] = signed
+	}
+
+	shimmed := map[pixiecore.Firmware]bool{}
+	if shimPath := v.GetString("sb-shim"); shimPath != "" {
+		shim := mustFile(shimPath)
+		if verify {
+			if err := secureboot.Verify(shim, roots); err != nil {
+				fatalf("shim %q failed signature verification: %s", shimPath, err)
+			}
+		}
+
+		// The shim, not our freshly-signed iPXE binary, is what
+		// actually gets served and boots first; chaining to the
+		// signed iPXE from there is the shim's own job, which is
+		// exactly what makes it a shim rather than the final boot
+		// target.
+		for _, fw := range efiFirmwares {
+			if _, ok := ipxe[fw]; ok {
+				ipxe[fw] = shim
+				shimmed[fw] = true
+			}
+		}
+	}
+
+	if verify {
+		for _, fw := range efiFirmwares {
+			if shimmed[fw] {
+				// Already verified above; re-verifying the same
+				// bytes against the same roots would be redundant.
+				continue
+			}
+			image, ok := ipxe[fw]
+			if !ok {
+				continue
+			}
+			if err := secureboot.Verify(image, roots); err != nil {
+				fatalf("signed binary for firmware %v failed verification: %s", fw, err)
+			}
+		}
+	}
+}
+
+func writeFile(path string, bs []byte) error {
+	return ioutil.WriteFile(path, bs, 0644)
+}
@@ -0,0 +1,55 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicast
+
+// blockBitmap tracks, per-block, whether a block has been sent at least
+// once. Sender never resets it, so each block goes out once in the
+// first pass; a NACKed block is retransmitted in the next pass rather
+// than immediately, so one straggler can't turn a 100-machine transfer
+// back into 100 unicast ones.
+type blockBitmap struct {
+	bits  []uint64
+	count int
+}
+
+func newBlockBitmap(blocks int) *blockBitmap {
+	return &blockBitmap{bits: make([]uint64, (blocks+63)/64)}
+}
+
+func (b *blockBitmap) set(block int) {
+	w, bit := block/64, uint(block%64)
+	if b.bits[w]&(1<<bit) == 0 {
+		b.bits[w] |= 1 << bit
+		b.count++
+	}
+}
+
+func (b *blockBitmap) isSet(block int) bool {
+	w, bit := block/64, uint(block%64)
+	return b.bits[w]&(1<<bit) != 0
+}
+
+func (b *blockBitmap) reset() {
+	for i := range b.bits {
+		b.bits[i] = 0
+	}
+	b.count = 0
+}
+
+// delivered returns how many distinct blocks have been set since the
+// last reset, for progress logging.
+func (b *blockBitmap) delivered() int {
+	return b.count
+}
@@ -0,0 +1,67 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package multicast serves the same artifact (kernel, initrd, ...) to
+// many machines at once over a multicast TFTP-style transfer (RFC
+// 2090 MTFTP), instead of one unicast HTTP/TFTP stream per client.
+// It's aimed at rack-scale reimaging, where a large number of machines
+// request the same artifact within a short window of each other.
+package multicast
+
+import (
+	"fmt"
+	"net"
+)
+
+// Config describes how a Scheduler should transmit artifacts.
+type Config struct {
+	// Group is the multicast group to send on, e.g. 239.1.2.3.
+	Group net.IP
+	// Port is the UDP port to send on.
+	Port int
+	// Interface is the name of the network interface to send from. If
+	// empty, the kernel picks one based on its multicast routes.
+	Interface string
+	// BlockSize is the number of artifact bytes per transmitted block,
+	// matching the TFTP blksize option.
+	BlockSize int
+	// Window is the number of blocks sent before pausing for NACKs, so
+	// a straggler can catch up without stalling the rest of the
+	// window.
+	Window int
+}
+
+// DefaultConfig matches the defaults pixiecore exposes on its
+// `--multicast-*` flags.
+var DefaultConfig = Config{
+	Port:      75, // the well-known MTFTP port
+	BlockSize: 512,
+	Window:    16,
+}
+
+func (c Config) validate() error {
+	if c.Group == nil || c.Group.To4() == nil || !c.Group.IsMulticast() {
+		return fmt.Errorf("multicast: %v is not an IPv4 multicast address", c.Group)
+	}
+	if c.Port <= 0 {
+		return fmt.Errorf("multicast: port must be >0, got %d", c.Port)
+	}
+	if c.BlockSize <= 0 {
+		return fmt.Errorf("multicast: block size must be >0, got %d", c.BlockSize)
+	}
+	if c.Window <= 0 {
+		return fmt.Errorf("multicast: window must be >0, got %d", c.Window)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicast
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batchWindow is how long the Scheduler waits after the first request
+// for an artifact before starting to transmit, so that concurrent
+// requests for the same artifact (the common case when 100+ machines
+// reboot into PXE at once) join a single multicast transmission
+// instead of each triggering its own.
+const batchWindow = 500 * time.Millisecond
+
+// Scheduler batches concurrent requests for the same artifact into a
+// single multicast Sender, instead of starting one per request.
+type Scheduler struct {
+	cfg  Config
+	send func(group string, block int, payload []byte) error
+
+	mu      sync.Mutex
+	senders map[string]*Sender
+}
+
+// NewScheduler builds a Scheduler that transmits on cfg.Group/cfg.Port,
+// using send to actually write a block to the multicast socket. send
+// is injected for the same reason as in NewSender.
+func NewScheduler(cfg Config, send func(group string, block int, payload []byte) error) *Scheduler {
+	return &Scheduler{
+		cfg:     cfg,
+		send:    send,
+		senders: map[string]*Sender{},
+	}
+}
+
+// Request asks the Scheduler to deliver data (identified by the stable
+// key artifact, e.g. its path or content hash) over multicast. If a
+// transmission for that artifact is already in flight, Request joins
+// it instead of starting a second one. It returns immediately; the
+// actual transmission runs in the background until ctx is canceled or
+// the Sender's Run returns (see Sender.Run).
+func (s *Scheduler) Request(ctx context.Context, artifact string, data []byte) (*Sender, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sender, ok := s.senders[artifact]; ok {
+		return sender, nil
+	}
+
+	sender, err := NewSender(s.cfg, data, func(block int, payload []byte) error {
+		return s.send(s.cfg.Group.String(), block, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.senders[artifact] = sender
+
+	go func() {
+		// Give other concurrent requesters a chance to join before
+		// the first block goes out.
+		select {
+		case <-ctx.Done():
+		case <-time.After(batchWindow):
+		}
+		// Errors here just mean the context was canceled or the
+		// socket died; there's no one left to report them to.
+		_ = sender.Run(ctx)
+
+		s.mu.Lock()
+		delete(s.senders, artifact)
+		s.mu.Unlock()
+	}()
+
+	return sender, nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicast
+
+import (
+	"context"
+	"time"
+)
+
+// nack is a retransmission request for a single block, reported by a
+// client that fell out of a transmission window.
+type nack struct {
+	block int
+}
+
+// Sender drives one multicast transmission of a single artifact: it
+// sends the artifact's blocks in fixed-size windows on a regular
+// cadence, and, in the pass after each one, retransmits any block a
+// client NACKed.
+//
+// A Sender is created per artifact by a Scheduler, which is also
+// responsible for batching concurrent requests for that artifact into
+// this one transmission rather than starting a Sender per request.
+type Sender struct {
+	cfg  Config
+	data []byte
+
+	blocks  int
+	window  *blockBitmap
+	nacks   chan nack
+	send    func(block int, payload []byte) error
+	cadence time.Duration
+}
+
+// NewSender builds a Sender for data, using send to actually put a
+// block on the wire. send is injected so tests (and callers on
+// platforms without raw multicast socket support) don't need a real
+// network.
+func NewSender(cfg Config, data []byte, send func(block int, payload []byte) error) (*Sender, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	blocks := (len(data) + cfg.BlockSize - 1) / cfg.BlockSize
+	return &Sender{
+		cfg:     cfg,
+		data:    data,
+		blocks:  blocks,
+		window:  newBlockBitmap(blocks),
+		nacks:   make(chan nack, cfg.Window*4),
+		send:    send,
+		cadence: 10 * time.Millisecond,
+	}, nil
+}
+
+// NACK queues a retransmission request for block. It never blocks the
+// caller (e.g. a DHCP/TFTP goroutine handling a client's NACK packet):
+// a full queue just drops the request, and the dropped block is not
+// retransmitted unless it's NACKed again. block comes straight
+// off a client's retry packet, so an out-of-range value (malformed or
+// malicious) is silently dropped rather than queued for sendWindow to
+// index out of bounds with later.
+func (s *Sender) NACK(block int) {
+	if block < 0 || block >= s.blocks {
+		return
+	}
+	select {
+	case s.nacks <- nack{block: block}:
+	default:
+	}
+}
+
+// Run transmits the artifact until every block has gone out at least
+// once and no NACKs arrive for one window's cadence, or until ctx is
+// canceled. It's meant to be run in its own goroutine by the
+// Scheduler.
+func (s *Sender) Run(ctx context.Context) error {
+	for {
+		sent, err := s.sendWindow(ctx, s.pendingBlocks())
+		if err != nil {
+			return err
+		}
+		if sent > 0 {
+			continue
+		}
+		// Nothing was pending: wait one cadence for late NACKs, and
+		// leave any that arrive queued for the next pendingBlocks.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.cadence):
+		}
+		if len(s.nacks) == 0 {
+			return nil
+		}
+	}
+}
+
+// pendingBlocks returns every block not yet sent, in order, followed
+// by any block a client has NACKed.
+func (s *Sender) pendingBlocks() []int {
+	var pending []int
+	for i := 0; i < s.blocks; i++ {
+		if !s.window.isSet(i) {
+			pending = append(pending, i)
+		}
+	}
+	pending = append(pending, s.drainNacks()...)
+	return pending
+}
+
+func (s *Sender) drainNacks() []int {
+	var blocks []int
+	for {
+		select {
+		case n := <-s.nacks:
+			// Defense in depth: NACK already rejects out-of-range
+			// blocks before they're queued, but don't trust the
+			// channel's contents blindly either.
+			if n.block >= 0 && n.block < s.blocks {
+				blocks = append(blocks, n.block)
+			}
+		default:
+			return blocks
+		}
+	}
+}
+
+func (s *Sender) sendWindow(ctx context.Context, blocks []int) (int, error) {
+	sent := 0
+	for i, block := range blocks {
+		if i > 0 && i%s.cfg.Window == 0 {
+			select {
+			case <-ctx.Done():
+				return sent, ctx.Err()
+			case <-time.After(s.cadence):
+			}
+		}
+
+		start := block * s.cfg.BlockSize
+		end := start + s.cfg.BlockSize
+		if end > len(s.data) {
+			end = len(s.data)
+		}
+		if err := s.send(block, s.data[start:end]); err != nil {
+			return sent, err
+		}
+		s.window.set(block)
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multicast
+
+import (
+	"net"
+	"testing"
+)
+
+func testConfig() Config {
+	return Config{
+		Group:     net.ParseIP("239.1.2.3"),
+		Port:      75,
+		BlockSize: 16,
+		Window:    4,
+	}
+}
+
+func TestNACKRejectsOutOfRangeBlocks(t *testing.T) {
+	data := make([]byte, 64) // 4 blocks of 16 bytes
+	s, err := NewSender(testConfig(), data, func(block int, payload []byte) error { return nil })
+	if err != nil {
+		t.Fatalf("NewSender: %v", err)
+	}
+
+	for _, block := range []int{-1, -100, s.blocks, s.blocks + 1} {
+		s.NACK(block)
+	}
+
+	if got := s.drainNacks(); len(got) != 0 {
+		t.Fatalf("drainNacks() = %v after out-of-range NACKs, want empty", got)
+	}
+}
+
+func TestNACKQueuesInRangeBlock(t *testing.T) {
+	data := make([]byte, 64)
+	s, err := NewSender(testConfig(), data, func(block int, payload []byte) error { return nil })
+	if err != nil {
+		t.Fatalf("NewSender: %v", err)
+	}
+
+	s.NACK(2)
+	if got := s.drainNacks(); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("drainNacks() = %v, want [2]", got)
+	}
+}
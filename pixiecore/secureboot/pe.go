@@ -0,0 +1,124 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secureboot
+
+import (
+	"crypto"
+	_ "crypto/sha256" // register crypto.SHA256
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// peLayout describes the handful of PE/COFF header fields we need to
+// compute an Authenticode digest and to locate (or append) the
+// certificate table, per the "Windows Authenticode Portable Executable
+// Signature Format" spec. We don't otherwise care about the image.
+type peLayout struct {
+	checksumOffset   int64 // offset of the OptionalHeader Checksum field
+	certTableOffset  int64 // offset of Data Directory[4] (cert table RVA+size)
+	certTableRVA     uint32
+	certTableSize    uint32
+	securityDirIndex int
+}
+
+const (
+	peSignatureOffsetPtr = 0x3c
+	certTableDirIndex    = 4 // IMAGE_DIRECTORY_ENTRY_SECURITY
+)
+
+func parsePE(image []byte) (*peLayout, error) {
+	if len(image) < peSignatureOffsetPtr+4 {
+		return nil, errors.New("secureboot: file too small to be a PE image")
+	}
+	peOffset := int64(binary.LittleEndian.Uint32(image[peSignatureOffsetPtr:]))
+	if peOffset <= 0 || int64(len(image)) < peOffset+24 {
+		return nil, errors.New("secureboot: malformed PE header offset")
+	}
+	if string(image[peOffset:peOffset+4]) != "PE\x00\x00" {
+		return nil, errors.New("secureboot: missing PE signature")
+	}
+
+	// COFF file header: Machine(2) NumberOfSections(2) TimeDateStamp(4)
+	// PointerToSymbolTable(4) NumberOfSymbols(4) SizeOfOptionalHeader(2)
+	// Characteristics(2).
+	coff := peOffset + 4
+	sizeOfOptionalHeader := binary.LittleEndian.Uint16(image[coff+16:])
+	optOffset := coff + 20
+	if sizeOfOptionalHeader == 0 || int64(len(image)) < optOffset+2 {
+		return nil, errors.New("secureboot: missing optional header")
+	}
+
+	magic := binary.LittleEndian.Uint16(image[optOffset:])
+	var checksumOffset, dataDirOffset int64
+	switch magic {
+	case 0x10b: // PE32
+		checksumOffset = optOffset + 64
+		dataDirOffset = optOffset + 96
+	case 0x20b: // PE32+
+		checksumOffset = optOffset + 64
+		dataDirOffset = optOffset + 112
+	default:
+		return nil, fmt.Errorf("secureboot: unsupported optional header magic %#x", magic)
+	}
+
+	certTableOffset := dataDirOffset + certTableDirIndex*8
+	if int64(len(image)) < certTableOffset+8 {
+		return nil, errors.New("secureboot: optional header too short for a cert table entry")
+	}
+
+	return &peLayout{
+		checksumOffset:  checksumOffset,
+		certTableOffset: certTableOffset,
+		certTableRVA:    binary.LittleEndian.Uint32(image[certTableOffset:]),
+		certTableSize:   binary.LittleEndian.Uint32(image[certTableOffset+4:]),
+	}, nil
+}
+
+// authenticodeDigest hashes the image per the Authenticode algorithm:
+// everything except the header checksum field and the existing
+// certificate table (header+contents), in file order. Any pre-existing
+// signature is therefore excluded, so re-signing a signed image is
+// well-defined.
+func authenticodeDigest(image []byte, hash crypto.Hash) ([]byte, error) {
+	layout, err := parsePE(image)
+	if err != nil {
+		return nil, err
+	}
+
+	h := hash.New()
+	h.Write(image[:layout.checksumOffset])
+	h.Write(image[layout.checksumOffset+4 : layout.certTableOffset])
+	// Skip over the cert table directory entry itself (RVA+size, 8
+	// bytes) and the signed data it points to, which by convention
+	// sits at the very end of the file.
+	rest := image[layout.certTableOffset+8:]
+	if layout.certTableRVA != 0 {
+		certStart := int64(layout.certTableRVA)
+		if certStart < layout.certTableOffset+8 || certStart > int64(len(image)) {
+			return nil, errors.New("secureboot: cert table RVA out of range")
+		}
+		rest = image[layout.certTableOffset+8 : certStart]
+	}
+	h.Write(rest)
+
+	return h.Sum(nil), nil
+}
+
+// sha256Digest is a convenience wrapper used by callers that don't need
+// to pick the hash algorithm explicitly.
+func sha256Digest(image []byte) ([]byte, error) {
+	return authenticodeDigest(image, crypto.SHA256)
+}
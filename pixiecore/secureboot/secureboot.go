@@ -0,0 +1,129 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secureboot signs and verifies EFI binaries (iPXE, kernels,
+// UKIs) with an Authenticode PE signature, so that machines with
+// Secure Boot enabled can chainload them without the operator having
+// to disable SB.
+//
+// This package is EFI-variable-agnostic: it only ever reads and
+// returns bytes. Enrolling the signing certificate into a machine's
+// db (or building a db-enrollable cert in the first place) is up to
+// the caller.
+package secureboot
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// KeyPair is a Secure Boot "db" signing key and its certificate, as
+// produced by the usual sbsign/openssl tooling.
+type KeyPair struct {
+	Key  crypto.Signer
+	Cert *x509.Certificate
+}
+
+// Sign returns a copy of the EFI image with an Authenticode signature
+// from kp appended to its certificate table.
+//
+// The returned image can be re-signed: Sign always (re-)computes the
+// digest over everything except the existing certificate table, so
+// calling Sign twice on the same input with different keys produces a
+// valid signature for the second key, not a corrupt double-signature.
+func Sign(image []byte, kp KeyPair) ([]byte, error) {
+	if kp.Key == nil || kp.Cert == nil {
+		return nil, errors.New("secureboot: Sign requires both a key and a certificate")
+	}
+
+	digest, err := sha256Digest(image)
+	if err != nil {
+		return nil, fmt.Errorf("secureboot: computing Authenticode digest: %w", err)
+	}
+
+	sd, err := pkcs7.NewSignedData(digest)
+	if err != nil {
+		return nil, fmt.Errorf("secureboot: building signed data: %w", err)
+	}
+	if err := sd.AddSigner(kp.Cert, kp.Key, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("secureboot: signing digest: %w", err)
+	}
+	sd.Detach()
+	signature, err := sd.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("secureboot: finishing signature: %w", err)
+	}
+
+	return appendCertTable(image, signature)
+}
+
+// Verify checks that image carries an Authenticode signature which
+// chains to one of the certificates in roots, and that the signature
+// covers the image's current contents (i.e. it hasn't been modified
+// since signing). It returns a non-nil error, and pixiecore should
+// refuse to serve the image, for anything short of a fully valid
+// chain.
+func Verify(image []byte, roots *x509.CertPool) error {
+	layout, err := parsePE(image)
+	if err != nil {
+		return err
+	}
+	if layout.certTableRVA == 0 || layout.certTableSize == 0 {
+		return errors.New("secureboot: image has no embedded signature")
+	}
+	if int64(layout.certTableRVA)+int64(layout.certTableSize) > int64(len(image)) {
+		return errors.New("secureboot: cert table extends past end of file")
+	}
+
+	wincert := image[layout.certTableRVA : layout.certTableRVA+layout.certTableSize]
+	signature, err := signedDataFromWinCert(wincert)
+	if err != nil {
+		return err
+	}
+
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		return fmt.Errorf("secureboot: parsing signature: %w", err)
+	}
+
+	digest, err := sha256Digest(image)
+	if err != nil {
+		return err
+	}
+	p7.Content = digest
+
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return fmt.Errorf("secureboot: signature does not chain to a trusted cert: %w", err)
+	}
+	return nil
+}
+
+// LoadKeyPair reads a PEM-encoded signing key and certificate from
+// disk: the files `pixiecore sign --sb-key --sb-cert` takes, as
+// produced by openssl.
+func LoadKeyPair(keyPath, certPath string) (KeyPair, error) {
+	key, err := loadSigner(keyPath)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("secureboot: loading key %q: %w", keyPath, err)
+	}
+	cert, err := loadCert(certPath)
+	if err != nil {
+		return KeyPair{}, fmt.Errorf("secureboot: loading cert %q: %w", certPath, err)
+	}
+	return KeyPair{Key: key, Cert: cert}, nil
+}
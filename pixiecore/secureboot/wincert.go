@@ -0,0 +1,84 @@
+// Copyright 2016 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secureboot
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A WIN_CERTIFICATE header, as laid out in the cert table a PE's
+// Security Directory points at: dwLength(4) wRevision(2) wCertificateType(2)
+// followed by bCertificate[dwLength-8].
+const (
+	winCertRevision1_0     = 0x0100
+	winCertTypePKCS7Signed = 0x0002
+)
+
+func appendCertTable(image []byte, signature []byte) ([]byte, error) {
+	layout, err := parsePE(image)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	certLen := uint32(8 + len(signature))
+	// The cert table is padded to an 8-byte boundary; pad the
+	// signature rather than the header so dwLength stays accurate.
+	pad := (8 - int(certLen)%8) % 8
+	binary.LittleEndian.PutUint32(header[0:], certLen+uint32(pad))
+	binary.LittleEndian.PutUint16(header[4:], winCertRevision1_0)
+	binary.LittleEndian.PutUint16(header[6:], winCertTypePKCS7Signed)
+
+	wincert := append(header, signature...)
+	wincert = append(wincert, make([]byte, pad)...)
+
+	// Everything between the old cert table entry and the start of any
+	// existing signature is untouched image content; anything from the
+	// old signature onward is replaced.
+	rest := image[layout.certTableOffset+8:]
+	if layout.certTableRVA != 0 && int64(layout.certTableRVA) >= layout.certTableOffset+8 {
+		rest = image[layout.certTableOffset+8 : layout.certTableRVA]
+	}
+
+	// wincert is appended right after rest, so that's its real RVA -
+	// not certTableOffset+8, which is just where the directory entry
+	// (not the cert data itself) lives.
+	certStart := layout.certTableOffset + 8 + int64(len(rest))
+
+	out := make([]byte, 0, certStart+int64(len(wincert)))
+	out = append(out, image[:layout.certTableOffset]...)
+
+	rva := make([]byte, 8)
+	binary.LittleEndian.PutUint32(rva[0:], uint32(certStart))
+	binary.LittleEndian.PutUint32(rva[4:], uint32(len(wincert)))
+	out = append(out, rva...)
+
+	out = append(out, rest...)
+	out = append(out, wincert...)
+
+	return out, nil
+}
+
+func signedDataFromWinCert(wincert []byte) ([]byte, error) {
+	if len(wincert) < 8 {
+		return nil, errors.New("secureboot: truncated WIN_CERTIFICATE header")
+	}
+	certType := binary.LittleEndian.Uint16(wincert[6:8])
+	if certType != winCertTypePKCS7Signed {
+		return nil, errors.New("secureboot: unsupported WIN_CERTIFICATE type (want PKCS7 signed data)")
+	}
+	return wincert[8:], nil
+}